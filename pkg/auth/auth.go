@@ -1,14 +1,25 @@
 package auth
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"fmt"
 	"log"
+	"math/big"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
+// defaultInviteTTL is how long a freshly created invite token stays
+// redeemable when CreateInviteToken is called without an explicit ttl.
+const defaultInviteTTL = 24 * time.Hour
+
+// inviteTokenAlphabet excludes visually ambiguous characters (0/O, 1/I) so
+// tokens are easy to type back in by hand.
+const inviteTokenAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
 type AuthConfig struct {
 	Enabled bool
 	AdminID int64
@@ -62,6 +73,18 @@ func NewUserStore(cfg AuthConfig) (*UserStore, error) {
 		return nil, fmt.Errorf("create table users: %w", err)
 	}
 
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS invite_tokens (
+			token      TEXT PRIMARY KEY,
+			created_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL,
+			used_by    INTEGER NULL
+		);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("create table invite_tokens: %w", err)
+	}
+
 	log.Printf("Auth: ENABLED. Admin ID=%d, DB=%s", cfg.AdminID, cfg.DBPath)
 	return &UserStore{
 		enabled: true,
@@ -74,6 +97,17 @@ func (s *UserStore) IsEnabled() bool {
 	return s != nil && s.enabled
 }
 
+// DB returns the underlying sqlite handle backing this store, or nil if
+// auth is disabled. Other packages that need to persist alongside user data
+// (e.g. conversation history) share this handle rather than opening their
+// own connection.
+func (s *UserStore) DB() *sql.DB {
+	if s == nil || !s.enabled {
+		return nil
+	}
+	return s.db
+}
+
 func (s *UserStore) IsAdmin(id int64) bool {
 	return s != nil && s.enabled && id == s.adminID
 }
@@ -165,3 +199,105 @@ func (s *UserStore) ListUsers(limit int) ([]DBUser, error) {
 	}
 	return res, nil
 }
+
+// CreateInviteToken generates a fresh one-time invite token redeemable for
+// ttl (defaulting to defaultInviteTTL when ttl <= 0) and stores it for later
+// redemption via RedeemInviteToken.
+func (s *UserStore) CreateInviteToken(ttl time.Duration) (string, error) {
+	if s == nil || !s.enabled {
+		return "", fmt.Errorf("auth is disabled")
+	}
+	if ttl <= 0 {
+		ttl = defaultInviteTTL
+	}
+
+	token, err := generateInviteToken()
+	if err != nil {
+		return "", fmt.Errorf("generate invite token: %w", err)
+	}
+
+	now := time.Now().UTC()
+	_, err = s.db.Exec(`
+		INSERT INTO invite_tokens (token, created_at, expires_at, used_by)
+		VALUES (?, ?, ?, NULL)
+	`, token, now.Format(time.RFC3339), now.Add(ttl).Format(time.RFC3339))
+	if err != nil {
+		return "", fmt.Errorf("insert invite token: %w", err)
+	}
+
+	return token, nil
+}
+
+// RedeemInviteToken validates token, marks it used by tgID, and enrolls tgID
+// via AddUser. Expired or already-used tokens are rejected with a
+// descriptive error.
+func (s *UserStore) RedeemInviteToken(token string, tgID int64) error {
+	if s == nil || !s.enabled {
+		return fmt.Errorf("auth is disabled")
+	}
+
+	var expiresAt string
+	var usedBy sql.NullInt64
+	err := s.db.QueryRow(`
+		SELECT expires_at, used_by FROM invite_tokens WHERE token = ?
+	`, token).Scan(&expiresAt, &usedBy)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("invite token not found")
+	}
+	if err != nil {
+		return err
+	}
+	if usedBy.Valid {
+		return fmt.Errorf("invite token already used")
+	}
+
+	expiry, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return fmt.Errorf("parse invite token expiry: %w", err)
+	}
+	if time.Now().UTC().After(expiry) {
+		return fmt.Errorf("invite token expired")
+	}
+
+	// Guard with "AND used_by IS NULL" rather than trusting the check above:
+	// two concurrent redemptions could otherwise both pass that check and
+	// both mark the token used. RowsAffected tells us whether we actually
+	// won the race.
+	res, err := s.db.Exec(`
+		UPDATE invite_tokens SET used_by = ? WHERE token = ? AND used_by IS NULL
+	`, tgID, token)
+	if err != nil {
+		return fmt.Errorf("mark invite token used: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("mark invite token used: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("invite token already used")
+	}
+
+	return s.AddUser(tgID)
+}
+
+// generateInviteToken returns an 8-character human-friendly token in the
+// "AB-12-CD" format: three dash-separated groups of two characters drawn
+// from inviteTokenAlphabet.
+func generateInviteToken() (string, error) {
+	const groups, groupLen = 3, 2
+
+	chars := make([]byte, groups*groupLen)
+	for i := range chars {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(inviteTokenAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		chars[i] = inviteTokenAlphabet[n.Int64()]
+	}
+
+	parts := make([]string, groups)
+	for i := 0; i < groups; i++ {
+		parts[i] = string(chars[i*groupLen : (i+1)*groupLen])
+	}
+	return strings.Join(parts, "-"), nil
+}
@@ -1,18 +1,34 @@
 package bot
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
 	"github.com/nexusriot/ollamabot/pkg/auth"
+	"github.com/nexusriot/ollamabot/pkg/config"
+	"github.com/nexusriot/ollamabot/pkg/quota"
+)
+
+// Streaming tuning: how often (and how much new text) it takes before we
+// push an edit to Telegram, and the hard per-message character limit.
+const (
+	streamEditInterval = 700 * time.Millisecond
+	streamEditMinChars = 200
+	telegramMaxChars   = 4096
 )
 
 type OllamaChatRequest struct {
@@ -33,38 +49,211 @@ type OllamaChatResponse struct {
 	Error   string        `json:"error,omitempty"`
 }
 
+// defaultSystemPrompt seeds every new conversation's system message. It
+// replaces what used to be a suffix appended to every single prompt.
+const defaultSystemPrompt = "Please answer in Markdown. Use fenced code blocks (```lang ... ```)."
+
 type Bot struct {
 	api           *tgbotapi.BotAPI
 	userStore     *auth.UserStore
+	conversations *ConversationStore
+	quota         *quota.Store
 	ollamaBaseURL string
-	model         string
+
+	summarizeModel  string
+	summarizePrompt string
+
+	// cfgMu guards the fields config.Watcher can hot-swap at runtime
+	// (everything else above is fixed for the process lifetime).
+	cfgMu          sync.RWMutex
+	model          string
+	systemPrompt   string
+	allowedModels  []string
+	rateLimit      config.RateLimit
+	adminRateLimit config.RateLimit
+
+	streamsMu sync.Mutex
+	streams   map[int64]context.Context // chatID -> context of the in-flight reply
+
+	modelsCache modelsCache
 }
 
-func NewBot(api *tgbotapi.BotAPI, userStore *auth.UserStore, ollamaBaseURL, model string) *Bot {
+// NewBot wires up a Bot from cfg. cfg.SummarizeModel selects the (typically
+// smaller, faster) model used for /summarize; an empty value falls back to
+// cfg.Model. cfg.Model, cfg.SystemPrompt, cfg.AllowedModels, cfg.RateLimit
+// and cfg.AdminRateLimit are later hot-reloadable via ApplyConfig.
+func NewBot(api *tgbotapi.BotAPI, userStore *auth.UserStore, cfg *config.Config) (*Bot, error) {
+	convDB, err := sql.Open("sqlite", cfg.ConversationDBPath)
+	if err != nil {
+		return nil, fmt.Errorf("open conversation db %q: %w", cfg.ConversationDBPath, err)
+	}
+	if err := convDB.Ping(); err != nil {
+		return nil, fmt.Errorf("open conversation db %q: %w (set conversation_db_path / BOT_CONVERSATION_DB_PATH to a writable location)", cfg.ConversationDBPath, err)
+	}
+
+	conversations, err := NewConversationStore(convDB, cfg.ConversationMaxTurns)
+	if err != nil {
+		return nil, fmt.Errorf("init conversation store: %w", err)
+	}
+
+	quotaStore, err := quota.NewStore(userStore.DB())
+	if err != nil {
+		return nil, fmt.Errorf("init quota store: %w", err)
+	}
+
+	summarizeModel := cfg.SummarizeModel
+	if summarizeModel == "" {
+		summarizeModel = cfg.Model
+	}
+
+	systemPrompt := cfg.SystemPrompt
+	if systemPrompt == "" {
+		systemPrompt = defaultSystemPrompt
+	}
+
 	return &Bot{
-		api:           api,
-		userStore:     userStore,
-		ollamaBaseURL: strings.TrimRight(ollamaBaseURL, "/"),
-		model:         model,
+		api:             api,
+		userStore:       userStore,
+		conversations:   conversations,
+		quota:           quotaStore,
+		ollamaBaseURL:   strings.TrimRight(cfg.OllamaBaseURL, "/"),
+		summarizeModel:  summarizeModel,
+		summarizePrompt: defaultSummarizePrompt,
+		model:           cfg.Model,
+		systemPrompt:    systemPrompt,
+		allowedModels:   cfg.AllowedModels,
+		rateLimit:       cfg.RateLimit,
+		adminRateLimit:  cfg.AdminRateLimit,
+		streams:         make(map[int64]context.Context),
+	}, nil
+}
+
+// ApplyConfig adopts the hot-reloadable subset of cfg (model, system prompt,
+// allowed models, rate limits) so it satisfies config.Reloadable. Changes to
+// cfg.TelegramToken, cfg.OllamaBaseURL or cfg.Auth require a restart and are
+// ignored here.
+func (b *Bot) ApplyConfig(cfg *config.Config) {
+	b.cfgMu.Lock()
+	defer b.cfgMu.Unlock()
+
+	if cfg.Model != "" {
+		b.model = cfg.Model
+	}
+	b.allowedModels = cfg.AllowedModels
+	if len(b.allowedModels) > 0 && !contains(b.allowedModels, b.model) {
+		log.Printf("config reload: active model %q is no longer in allowed_models; leaving it in place until changed explicitly", b.model)
+	}
+
+	systemPrompt := cfg.SystemPrompt
+	if systemPrompt == "" {
+		systemPrompt = defaultSystemPrompt
 	}
+	b.systemPrompt = systemPrompt
+	b.rateLimit = cfg.RateLimit
+	b.adminRateLimit = cfg.AdminRateLimit
 }
 
-// sendTypingUntilDone periodically sends "typing" action until done is closed.
-func (b *Bot) sendTypingUntilDone(chatID int64, done <-chan struct{}) {
-	ticker := time.NewTicker(4 * time.Second)
-	defer ticker.Stop()
+// quotaLimits returns the rate limit tier that applies to userID: the admin
+// tier for the configured admin, the regular tier otherwise.
+func (b *Bot) quotaLimits(userID int64) quota.Limits {
+	b.cfgMu.RLock()
+	rl := b.rateLimit
+	if b.userStore.IsAdmin(userID) {
+		rl = b.adminRateLimit
+	}
+	b.cfgMu.RUnlock()
 
-	for {
-		select {
-		case <-done:
-			return
-		case <-ticker.C:
-			// best-effort, ignore errors
-			_, _ = b.api.Send(tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping))
+	return quota.Limits{
+		RequestsPerMinute: rl.RequestsPerMinute,
+		Burst:             rl.Burst,
+		RequestsPerDay:    rl.RequestsPerDay,
+		MaxPromptChars:    rl.MaxPromptChars,
+	}
+}
+
+// getModel returns the active model.
+func (b *Bot) getModel() string {
+	b.cfgMu.RLock()
+	defer b.cfgMu.RUnlock()
+	return b.model
+}
+
+// getSystemPrompt returns the conversation system prompt new conversations
+// are seeded with.
+func (b *Bot) getSystemPrompt() string {
+	b.cfgMu.RLock()
+	defer b.cfgMu.RUnlock()
+	return b.systemPrompt
+}
+
+// isModelAllowed reports whether model may be selected. An empty
+// allow-list means every installed model is allowed.
+func (b *Bot) isModelAllowed(model string) bool {
+	b.cfgMu.RLock()
+	defer b.cfgMu.RUnlock()
+	return len(b.allowedModels) == 0 || contains(b.allowedModels, model)
+}
+
+// filterAllowed narrows models to the configured allow-list, or returns
+// models unchanged when no allow-list is configured.
+func (b *Bot) filterAllowed(models []string) []string {
+	b.cfgMu.RLock()
+	allowed := b.allowedModels
+	b.cfgMu.RUnlock()
+
+	if len(allowed) == 0 {
+		return models
+	}
+	var out []string
+	for _, m := range models {
+		if contains(allowed, m) {
+			out = append(out, m)
 		}
 	}
+	return out
 }
 
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// startStream cancels any reply still streaming to chatID and registers a
+// fresh context as the new in-flight reply for that chat.
+func (b *Bot) startStream(chatID int64) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b.streamsMu.Lock()
+	if prevCtx, ok := b.streams[chatID]; ok {
+		if prevCancel, ok := prevCtx.Value(cancelKey{}).(context.CancelFunc); ok {
+			prevCancel()
+		}
+	}
+	ctx = context.WithValue(ctx, cancelKey{}, cancel)
+	b.streams[chatID] = ctx
+	b.streamsMu.Unlock()
+
+	return ctx
+}
+
+// endStream clears the registered context for chatID once a reply finishes,
+// unless a newer stream has already replaced it.
+func (b *Bot) endStream(chatID int64, ctx context.Context) {
+	b.streamsMu.Lock()
+	if current, ok := b.streams[chatID]; ok && current == ctx {
+		delete(b.streams, chatID)
+	}
+	b.streamsMu.Unlock()
+}
+
+// cancelKey is the context key under which startStream stashes a stream's own
+// cancel func, so a later call can cancel it without a separate map.
+type cancelKey struct{}
+
 func (b *Bot) Run() {
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
@@ -72,6 +261,11 @@ func (b *Bot) Run() {
 	updates := b.api.GetUpdatesChan(u)
 
 	for update := range updates {
+		if update.CallbackQuery != nil {
+			b.handleCallbackQuery(update.CallbackQuery)
+			continue
+		}
+
 		if update.Message == nil {
 			continue
 		}
@@ -83,6 +277,17 @@ func (b *Bot) Run() {
 		userID := update.Message.From.ID
 		text := strings.TrimSpace(update.Message.Text)
 
+		if update.Message.Document != nil {
+			if !b.authorize(chatID, userID) {
+				continue
+			}
+			if !b.checkQuota(chatID, userID, text) {
+				continue
+			}
+			b.handleDocument(chatID, userID, update.Message.Document)
+			continue
+		}
+
 		if text == "" {
 			continue
 		}
@@ -97,6 +302,11 @@ func (b *Bot) Run() {
 				b.handleListUsers(chatID)
 				continue
 			}
+
+			if strings.HasPrefix(text, "/invite") {
+				b.handleInvite(chatID, text)
+				continue
+			}
 		}
 
 		if strings.HasPrefix(text, "/whoami") {
@@ -104,82 +314,150 @@ func (b *Bot) Run() {
 			continue
 		}
 
-		if b.userStore.IsEnabled() {
-			allowed, err := b.userStore.IsAuthorized(userID)
-			if err != nil {
-				log.Printf("auth error for user %d: %v", userID, err)
-				msg := tgbotapi.NewMessage(chatID,
-					"âš ï¸ Internal auth error, please try again later.")
-				_, _ = b.api.Send(msg)
-				continue
-			}
+		// /start <token> is a public deep link used to redeem an invite, so
+		// it must be handled before the auth gate below. A bare /start (no
+		// token) falls through to the normal auth-gated welcome message.
+		if parts := strings.Fields(text); len(parts) >= 2 && parts[0] == "/start" {
+			b.handleStartWithToken(chatID, userID, parts[1])
+			continue
+		}
 
-			if !allowed {
-				msg := tgbotapi.NewMessage(chatID,
-					"ðŸš« You are not allowed to use this bot.\n"+
-						"Ask the admin to add your Telegram ID.")
-				_, _ = b.api.Send(msg)
-				continue
-			}
+		if !b.authorize(chatID, userID) {
+			continue
+		}
 
-			// user is allowed; update last_activity (best effort)
-			if err := b.userStore.Touch(userID); err != nil {
-				log.Printf("failed to update last_activity for %d: %v", userID, err)
-			}
+		if !b.checkQuota(chatID, userID, text) {
+			continue
 		}
 
 		if strings.HasPrefix(text, "/start") {
 			msg := tgbotapi.NewMessage(chatID,
-				"Hi! Send me any message and I'll forward it to Ollama ("+b.model+").\n\n"+
+				"Hi! Send me any message and I'll forward it to Ollama ("+b.getModel()+").\n\n"+
 					"Code blocks with ``` will be rendered as code in Telegram.")
 			msg.ParseMode = "Markdown"
 			_, _ = b.api.Send(msg)
 			continue
 		}
 
+		if strings.HasPrefix(text, "/models") {
+			go b.handleModelsCommand(chatID)
+			continue
+		}
+
 		if strings.HasPrefix(text, "/model") {
-			b.handleModelCommand(chatID, text)
+			go b.handleModelCommand(chatID, text)
+			continue
+		}
+
+		if strings.HasPrefix(text, "/reset") {
+			b.handleReset(chatID, userID)
+			continue
+		}
+
+		if strings.HasPrefix(text, "/system") {
+			b.handleSetSystem(chatID, userID, text)
+			continue
+		}
+
+		if strings.HasPrefix(text, "/history") {
+			b.handleHistory(chatID, userID)
+			continue
+		}
+
+		if strings.HasPrefix(text, "/usage") {
+			b.handleUsage(chatID, userID)
+			continue
+		}
+
+		if strings.HasPrefix(text, "/summarize") || bareURLPattern.MatchString(text) {
+			b.handleSummarize(chatID, userID, text)
 			continue
 		}
 
 		// Initial typing indicator
 		_, _ = b.api.Send(tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping))
 
+		messages, err := b.conversationMessages(userID, chatID, text)
+		if err != nil {
+			log.Printf("failed to load conversation history for %d/%d: %v", userID, chatID, err)
+			msg := tgbotapi.NewMessage(chatID, "âš ï¸ Internal error, please try again later.")
+			_, _ = b.api.Send(msg)
+			continue
+		}
+
+		if err := b.conversations.AppendTurn(userID, chatID, "user", text); err != nil {
+			log.Printf("failed to store turn for %d/%d: %v", userID, chatID, err)
+		}
+
 		// capture current model so changing /model later
 		// doesn't affect this request mid-flight
-		currentModel := b.model
-		prompt := text
-
-		// Handle Ollama call in background with progress "typing..."
-		go func(chatID int64, prompt, modelForCall string) {
-			done := make(chan struct{})
+		currentModel := b.getModel()
+		promptChars := len(text)
 
-			// progress goroutine
-			go b.sendTypingUntilDone(chatID, done)
+		// A new message in this chat supersedes any reply still streaming.
+		ctx := b.startStream(chatID)
 
-			reply, err := b.callOllama(modelForCall, prompt)
+		go func(ctx context.Context, chatID, userID int64, messages []OllamaMessage, modelForCall string, promptChars int) {
+			defer b.endStream(chatID, ctx)
 
-			// stop typing loop
-			close(done)
+			placeholder, err := b.api.Send(tgbotapi.NewMessage(chatID, "..."))
+			if err != nil {
+				log.Printf("failed to send placeholder message: %v", err)
+				return
+			}
+			streamer := newMessageStreamer(b.api, chatID, placeholder.MessageID)
 
+			var full strings.Builder
+			err = b.streamOllama(ctx, modelForCall, messages, func(delta string, done bool) error {
+				full.WriteString(delta)
+				return streamer.append(delta, done)
+			})
 			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					return
+				}
 				log.Printf("ollama error: %v", err)
 				msg := tgbotapi.NewMessage(chatID, "âš ï¸ Error from backend: "+err.Error())
 				_, _ = b.api.Send(msg)
 				return
 			}
 
-			msg := tgbotapi.NewMessage(chatID, reply)
-			msg.ParseMode = "Markdown"
-			msg.DisableWebPagePreview = true
+			if err := b.conversations.AppendTurn(userID, chatID, "assistant", full.String()); err != nil {
+				log.Printf("failed to store reply for %d/%d: %v", userID, chatID, err)
+			}
 
-			for _, chunk := range splitTelegramMessage(reply, 4000) {
-				msg.Text = chunk
-				_, _ = b.api.Send(msg)
-				time.Sleep(300 * time.Millisecond)
+			if err := b.quota.RecordUsage(userID, promptChars, full.Len()); err != nil {
+				log.Printf("failed to record usage for %d: %v", userID, err)
 			}
-		}(chatID, prompt, currentModel)
+		}(ctx, chatID, userID, messages, currentModel, promptChars)
+	}
+}
+
+// conversationMessages returns the full message list to send to Ollama for
+// the next turn: the conversation's system message (seeding a default one on
+// first use), its remembered history, and the new user prompt.
+func (b *Bot) conversationMessages(userID, chatID int64, prompt string) ([]OllamaMessage, error) {
+	history, err := b.conversations.History(userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	hasSystem := false
+	for _, m := range history {
+		if m.Role == "system" {
+			hasSystem = true
+			break
+		}
+	}
+	if !hasSystem {
+		systemPrompt := b.getSystemPrompt()
+		if err := b.conversations.SetSystem(userID, chatID, systemPrompt); err != nil {
+			return nil, err
+		}
+		history = append([]OllamaMessage{{Role: "system", Content: systemPrompt}}, history...)
 	}
+
+	return append(history, OllamaMessage{Role: "user", Content: prompt}), nil
 }
 
 func (b *Bot) handleAddUser(chatID int64, text string) {
@@ -227,15 +505,127 @@ func (b *Bot) handleListUsers(chatID int64) {
 	var sb strings.Builder
 	sb.WriteString("Registered users:\n")
 	for _, urow := range users {
+		requestsToday := 0
+		if usage, err := b.quota.Today(urow.TelegramID); err != nil {
+			log.Printf("/listusers: usage lookup failed for %d: %v", urow.TelegramID, err)
+		} else {
+			requestsToday = usage.Requests
+		}
+
 		fmt.Fprintf(&sb,
-			"- ID: %d\n  created_at: %s\n  last_activity: %s\n",
-			urow.TelegramID, urow.CreatedAt, urow.LastActivity)
+			"- ID: %d\n  created_at: %s\n  last_activity: %s\n  requests_today: %d\n",
+			urow.TelegramID, urow.CreatedAt, urow.LastActivity, requestsToday)
 	}
 
 	msg := tgbotapi.NewMessage(chatID, sb.String())
 	_, _ = b.api.Send(msg)
 }
 
+func (b *Bot) handleInvite(chatID int64, text string) {
+	var ttl time.Duration
+	if parts := strings.Fields(text); len(parts) >= 2 {
+		parsed, err := time.ParseDuration(parts[1])
+		if err != nil {
+			msg := tgbotapi.NewMessage(chatID, "Invalid ttl (e.g. 2h, 30m). Usage: /invite [ttl]")
+			_, _ = b.api.Send(msg)
+			return
+		}
+		ttl = parsed
+	}
+
+	token, err := b.userStore.CreateInviteToken(ttl)
+	if err != nil {
+		log.Printf("/invite error: %v", err)
+		msg := tgbotapi.NewMessage(chatID, "âš ï¸ Failed to create invite: "+err.Error())
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	link := fmt.Sprintf("https://t.me/%s?start=%s", b.api.Self.UserName, token)
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Invite token: `%s`\n%s", token, link))
+	msg.ParseMode = "Markdown"
+	_, _ = b.api.Send(msg)
+}
+
+func (b *Bot) handleStartWithToken(chatID, userID int64, token string) {
+	if err := b.userStore.RedeemInviteToken(token, userID); err != nil {
+		log.Printf("invite redeem error for %d: %v", userID, err)
+		msg := tgbotapi.NewMessage(chatID, "ðŸš« "+err.Error())
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "âœ… You're enrolled! Send me a message to get started.")
+	_, _ = b.api.Send(msg)
+}
+
+// authorize reports whether userID may proceed, sending an explanatory
+// message and touching last_activity as a side effect (matching the prior
+// inline behavior). Returns true when auth is disabled or the user is
+// allowed.
+func (b *Bot) authorize(chatID, userID int64) bool {
+	if !b.userStore.IsEnabled() {
+		return true
+	}
+
+	allowed, err := b.userStore.IsAuthorized(userID)
+	if err != nil {
+		log.Printf("auth error for user %d: %v", userID, err)
+		msg := tgbotapi.NewMessage(chatID,
+			"âš ï¸ Internal auth error, please try again later.")
+		_, _ = b.api.Send(msg)
+		return false
+	}
+
+	if !allowed {
+		msg := tgbotapi.NewMessage(chatID,
+			"ðŸš« You are not allowed to use this bot.\n"+
+				"Ask the admin to add your Telegram ID.")
+		_, _ = b.api.Send(msg)
+		return false
+	}
+
+	// user is allowed; update last_activity (best effort)
+	if err := b.userStore.Touch(userID); err != nil {
+		log.Printf("failed to update last_activity for %d: %v", userID, err)
+	}
+	return true
+}
+
+// checkQuota enforces the caller's rate limit tier right after authorize,
+// sending a friendly rejection message and returning false on a prompt
+// that's too long, a burst-limit hit, or a daily cap hit.
+func (b *Bot) checkQuota(chatID, userID int64, text string) bool {
+	limits := b.quotaLimits(userID)
+
+	result, err := b.quota.Allow(userID, limits, len(text))
+	if err != nil {
+		log.Printf("quota check error for %d: %v", userID, err)
+		msg := tgbotapi.NewMessage(chatID, "âš ï¸ Internal error, please try again later.")
+		_, _ = b.api.Send(msg)
+		return false
+	}
+	if result.Allowed {
+		return true
+	}
+
+	var reply string
+	switch result.Reason {
+	case quota.ReasonBurst:
+		reply = fmt.Sprintf("ðŸš« Slow down, try again in %ds.", int(math.Ceil(result.RetryAfter.Seconds())))
+	case quota.ReasonDailyCap:
+		reply = "ðŸš« You've reached your daily request limit. Try again tomorrow."
+	case quota.ReasonPromptTooLong:
+		reply = fmt.Sprintf("ðŸš« That message is too long (max %d characters).", limits.MaxPromptChars)
+	default:
+		reply = "ðŸš« Request denied."
+	}
+
+	msg := tgbotapi.NewMessage(chatID, reply)
+	_, _ = b.api.Send(msg)
+	return false
+}
+
 func (b *Bot) handleWhoAmI(chatID, userID int64) {
 	var sb strings.Builder
 	sb.WriteString("Your info:\n")
@@ -264,78 +654,419 @@ func (b *Bot) handleWhoAmI(chatID, userID int64) {
 	_, _ = b.api.Send(msg)
 }
 
+// modelCallbackPrefix tags inline keyboard button data for model-switch
+// callbacks, so handleCallbackQuery can route them without ambiguity.
+const modelCallbackPrefix = "model:"
+
+// ambiguityMargin is how much closer the best fuzzy match has to be than the
+// runner-up (in Levenshtein distance) before handleModelCommand auto-selects
+// it instead of asking the user to pick.
+const ambiguityMargin = 2
+
+// maxAutoSelectDistanceRatio caps the best fuzzy match's edit distance, as a
+// fraction of the query length, that handleModelCommand will still
+// auto-select. Beyond this the query is too unlike any candidate to have
+// been a typo of it, so the user is told no model matches rather than having
+// an unrelated model silently switched in.
+const maxAutoSelectDistanceRatio = 0.5
+
+func (b *Bot) handleModelsCommand(chatID int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), modelsFetchTimeout)
+	defer cancel()
+
+	models, err := b.ListModels(ctx)
+	if err != nil {
+		log.Printf("/models error: %v", err)
+		msg := tgbotapi.NewMessage(chatID, "âš ï¸ Failed to list models: "+err.Error())
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	if len(models) == 0 {
+		msg := tgbotapi.NewMessage(chatID, "Ollama reports no installed models.")
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Installed models:\n")
+	for _, m := range models {
+		fmt.Fprintf(&sb, "- %s\n", m)
+	}
+
+	msg := tgbotapi.NewMessage(chatID, sb.String())
+	_, _ = b.api.Send(msg)
+}
+
+// handleModelCommand switches the active model. An argument that doesn't
+// exactly match an installed model is fuzzy-matched against the cached
+// /api/tags list: an unambiguous closest match is selected directly,
+// ambiguous ones offer the top 3 candidates as tap-to-select buttons, and a
+// best match too far (in Levenshtein distance, relative to the query's
+// length) from any candidate is reported as no match at all rather than
+// picked.
 func (b *Bot) handleModelCommand(chatID int64, text string) {
 	parts := strings.Fields(text)
-	if len(parts) >= 2 {
-		b.model = parts[1]
-		reply := fmt.Sprintf("âœ… Model changed to `%s`", b.model)
-		msg := tgbotapi.NewMessage(chatID, reply)
+	if len(parts) < 2 {
+		msg := tgbotapi.NewMessage(chatID,
+			fmt.Sprintf("Current model: `%s`\nUsage: `/model llama3.1`", b.getModel()))
 		msg.ParseMode = "Markdown"
 		_, _ = b.api.Send(msg)
-	} else {
+		return
+	}
+	requested := parts[1]
+
+	ctx, cancel := context.WithTimeout(context.Background(), modelsFetchTimeout)
+	defer cancel()
+
+	models, err := b.ListModels(ctx)
+	if err != nil {
+		log.Printf("/model: failed to list models: %v", err)
+		msg := tgbotapi.NewMessage(chatID, "âš ï¸ Failed to query available models: "+err.Error())
+		_, _ = b.api.Send(msg)
+		return
+	}
+	models = b.filterAllowed(models)
+
+	for _, m := range models {
+		if m == requested {
+			b.setModel(chatID, m)
+			return
+		}
+	}
+
+	matches := fuzzyMatchModels(requested, models)
+	if len(matches) == 0 || matches[0].Distance > int(math.Ceil(float64(len(requested))*maxAutoSelectDistanceRatio)) {
 		msg := tgbotapi.NewMessage(chatID,
-			fmt.Sprintf("Current model: `%s`\nUsage: `/model llama3.1`", b.model))
+			fmt.Sprintf("No model matching %q is available to you. Use /models to check.", requested))
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	if len(matches) == 1 || matches[1].Distance-matches[0].Distance >= ambiguityMargin {
+		b.setModel(chatID, matches[0].Name)
+		return
+	}
+
+	suggestions := matches
+	if len(suggestions) > 3 {
+		suggestions = suggestions[:3]
+	}
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, m := range suggestions {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(m.Name, modelCallbackPrefix+m.Name))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Multiple models match %q, pick one:", requested))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(buttons...))
+	_, _ = b.api.Send(msg)
+}
+
+// trySetModel enforces allowedModels and, if model passes, swaps it in as
+// the active model. Reports whether the switch happened.
+func (b *Bot) trySetModel(model string) bool {
+	if !b.isModelAllowed(model) {
+		return false
+	}
+	b.cfgMu.Lock()
+	b.model = model
+	b.cfgMu.Unlock()
+	return true
+}
+
+// setModel switches the active model and confirms it in chatID.
+func (b *Bot) setModel(chatID int64, model string) {
+	if !b.trySetModel(model) {
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Model `%s` isn't in the allowed list for this bot.", model))
 		msg.ParseMode = "Markdown"
 		_, _ = b.api.Send(msg)
+		return
+	}
+
+	reply := fmt.Sprintf("âœ… Model changed to `%s`", model)
+	msg := tgbotapi.NewMessage(chatID, reply)
+	msg.ParseMode = "Markdown"
+	_, _ = b.api.Send(msg)
+}
+
+// handleCallbackQuery answers inline keyboard taps. Currently the only
+// callbacks in flight are model-switch buttons from handleModelCommand.
+func (b *Bot) handleCallbackQuery(cb *tgbotapi.CallbackQuery) {
+	data := cb.Data
+	if !strings.HasPrefix(data, modelCallbackPrefix) {
+		_, _ = b.api.Request(tgbotapi.NewCallback(cb.ID, ""))
+		return
+	}
+
+	if cb.Message == nil || !b.authorize(cb.Message.Chat.ID, cb.From.ID) {
+		_, _ = b.api.Request(tgbotapi.NewCallback(cb.ID, "You are not allowed to use this bot."))
+		return
+	}
+
+	model := strings.TrimPrefix(data, modelCallbackPrefix)
+	if !b.trySetModel(model) {
+		_, _ = b.api.Request(tgbotapi.NewCallback(cb.ID, fmt.Sprintf("%s is no longer allowed", model)))
+		return
+	}
+
+	_, _ = b.api.Request(tgbotapi.NewCallback(cb.ID, fmt.Sprintf("Model set to %s", model)))
+
+	if cb.Message != nil {
+		edit := tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID,
+			fmt.Sprintf("âœ… Model changed to `%s`", model))
+		edit.ParseMode = "Markdown"
+		_, _ = b.api.Send(edit)
+	}
+}
+
+func (b *Bot) handleReset(chatID, userID int64) {
+	if err := b.conversations.Reset(userID, chatID); err != nil {
+		log.Printf("/reset error for %d/%d: %v", userID, chatID, err)
+		msg := tgbotapi.NewMessage(chatID, "âš ï¸ Failed to reset conversation: "+err.Error())
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "âœ… Conversation history cleared.")
+	_, _ = b.api.Send(msg)
+}
+
+func (b *Bot) handleSetSystem(chatID, userID int64, text string) {
+	prompt := strings.TrimSpace(strings.TrimPrefix(text, "/system"))
+	if prompt == "" {
+		msg := tgbotapi.NewMessage(chatID, "Usage: /system <prompt>")
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	if err := b.conversations.SetSystem(userID, chatID, prompt); err != nil {
+		log.Printf("/system error for %d/%d: %v", userID, chatID, err)
+		msg := tgbotapi.NewMessage(chatID, "âš ï¸ Failed to set system prompt: "+err.Error())
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "âœ… System prompt updated.")
+	_, _ = b.api.Send(msg)
+}
+
+func (b *Bot) handleHistory(chatID, userID int64) {
+	n, err := b.conversations.TurnCount(userID, chatID)
+	if err != nil {
+		log.Printf("/history error for %d/%d: %v", userID, chatID, err)
+		msg := tgbotapi.NewMessage(chatID, "âš ï¸ Failed to read history: "+err.Error())
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Conversation turns remembered: %d (max %d)", n, b.conversations.MaxTurns()))
+	_, _ = b.api.Send(msg)
+}
+
+// handleUsage reports userID's own usage counters for the current day.
+func (b *Bot) handleUsage(chatID, userID int64) {
+	usage, err := b.quota.Today(userID)
+	if err != nil {
+		log.Printf("/usage error for %d: %v", userID, err)
+		msg := tgbotapi.NewMessage(chatID, "âš ï¸ Failed to read usage: "+err.Error())
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	limits := b.quotaLimits(userID)
+
+	var sb strings.Builder
+	sb.WriteString("Today's usage:\n")
+	if limits.RequestsPerDay > 0 {
+		fmt.Fprintf(&sb, "- Requests: %d / %d\n", usage.Requests, limits.RequestsPerDay)
+	} else {
+		fmt.Fprintf(&sb, "- Requests: %d\n", usage.Requests)
 	}
+	fmt.Fprintf(&sb, "- Prompt chars: %d\n", usage.PromptChars)
+	fmt.Fprintf(&sb, "- Completion chars: %d\n", usage.CompletionChars)
+
+	msg := tgbotapi.NewMessage(chatID, sb.String())
+	_, _ = b.api.Send(msg)
 }
 
-func (b *Bot) callOllama(model, prompt string) (string, error) {
+// streamOllama issues a streaming chat request to Ollama and invokes onDelta
+// for each message chunk as it arrives over the newline-delimited JSON
+// response. onDelta is called with done=true exactly once, for the final
+// chunk (whose delta may be empty). Returns ctx.Err() if ctx is canceled
+// mid-stream.
+func (b *Bot) streamOllama(ctx context.Context, model string, messages []OllamaMessage, onDelta func(delta string, done bool) error) error {
 	reqBody := OllamaChatRequest{
-		Model: model,
-		Messages: []OllamaMessage{
-			{
-				Role: "user",
-				Content: prompt + "\n\n" +
-					"Please answer in Markdown. Use fenced code blocks (```lang ... ```).",
-			},
-		},
-		Stream: false,
+		Model:    model,
+		Messages: messages,
+		Stream:   true,
 	}
 
 	data, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.ollamaBaseURL+"/api/chat", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	url := b.ollamaBaseURL + "/api/chat"
-	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("http post: %w", err)
+		return fmt.Errorf("http post: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		var buf bytes.Buffer
 		_, _ = buf.ReadFrom(resp.Body)
-		return "", fmt.Errorf("ollama HTTP %d: %s", resp.StatusCode, buf.String())
+		return fmt.Errorf("ollama HTTP %d: %s", resp.StatusCode, buf.String())
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk OllamaChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("decode chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return fmt.Errorf("ollama error: %s", chunk.Error)
+		}
+
+		if err := onDelta(chunk.Message.Content, chunk.Done); err != nil {
+			return err
+		}
+		if chunk.Done {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return ctx.Err()
+}
+
+// messageStreamer incrementally renders a streamed Ollama reply into
+// Telegram by periodically editing a placeholder message, rolling over into
+// a new message whenever the 4096-char Telegram limit would be exceeded.
+type messageStreamer struct {
+	api    *tgbotapi.BotAPI
+	chatID int64
+
+	msgID     int
+	text      string
+	lastEdit  time.Time
+	sinceEdit int
+}
+
+func newMessageStreamer(api *tgbotapi.BotAPI, chatID int64, msgID int) *messageStreamer {
+	return &messageStreamer{api: api, chatID: chatID, msgID: msgID}
+}
+
+// append adds delta to the message being streamed, rolling over into a new
+// Telegram message on overflow, and flushes an edit when enough time or text
+// has accumulated (always flushing on done).
+func (s *messageStreamer) append(delta string, done bool) error {
+	for len(delta) > 0 {
+		room := telegramMaxChars - len(s.text)
+		if room <= 0 {
+			if err := s.rollover(); err != nil {
+				return err
+			}
+			room = telegramMaxChars
+		}
+
+		take := len(delta)
+		if take > room {
+			take = room
+		}
+		s.text += delta[:take]
+		s.sinceEdit += take
+		delta = delta[take:]
 	}
 
-	var oresp OllamaChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&oresp); err != nil {
-		return "", fmt.Errorf("decode response: %w", err)
+	due := done || time.Since(s.lastEdit) >= streamEditInterval || s.sinceEdit >= streamEditMinChars
+	if !due {
+		return nil
 	}
-	if oresp.Error != "" {
-		return "", fmt.Errorf("ollama error: %s", oresp.Error)
+	return s.flush()
+}
+
+// rollover finalizes the current Telegram message and starts a fresh one for
+// subsequent text.
+func (s *messageStreamer) rollover() error {
+	if err := s.flush(); err != nil {
+		return err
 	}
 
-	return strings.TrimSpace(oresp.Message.Content), nil
+	sent, err := s.api.Send(tgbotapi.NewMessage(s.chatID, "..."))
+	if err != nil {
+		return fmt.Errorf("send rollover message: %w", err)
+	}
+	s.msgID = sent.MessageID
+	s.text = ""
+	s.sinceEdit = 0
+	s.lastEdit = time.Time{}
+	return nil
 }
 
-func splitTelegramMessage(s string, max int) []string {
-	if len(s) <= max {
-		return []string{s}
+// flush pushes the accumulated text to Telegram via editMessageText, backing
+// off and retrying once on a 429 (flood control) response. Streamed text is
+// truncated at arbitrary character boundaries, so intermediate flushes often
+// contain unbalanced Markdown (an open "```" or "*"); if Telegram rejects the
+// entities, flush retries the same edit as plain text rather than aborting
+// the stream.
+func (s *messageStreamer) flush() error {
+	text := s.text
+	if text == "" {
+		text = "..."
+	}
+
+	edit := tgbotapi.NewEditMessageText(s.chatID, s.msgID, text)
+	edit.ParseMode = "Markdown"
+
+	_, err := s.api.Send(edit)
+	if err != nil {
+		var tgErr *tgbotapi.Error
+		if errors.As(err, &tgErr) && tgErr.Code == http.StatusTooManyRequests {
+			wait := time.Duration(tgErr.RetryAfter) * time.Second
+			if wait <= 0 {
+				wait = time.Second
+			}
+			time.Sleep(wait)
+			_, err = s.api.Send(edit)
+		}
 	}
-	var res []string
-	runes := []rune(s)
-	for len(runes) > max {
-		res = append(res, string(runes[:max]))
-		runes = runes[max:]
+	if err != nil && isCantParseEntities(err) {
+		edit.ParseMode = ""
+		_, err = s.api.Send(edit)
 	}
-	if len(runes) > 0 {
-		res = append(res, string(runes))
+	if err != nil {
+		return fmt.Errorf("edit message: %w", err)
+	}
+
+	s.lastEdit = time.Now()
+	s.sinceEdit = 0
+	return nil
+}
+
+// isCantParseEntities reports whether err is Telegram's HTTP 400 response to
+// editMessageText/sendMessage when ParseMode is set and the text contains
+// unbalanced Markdown entities.
+func isCantParseEntities(err error) bool {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		return false
 	}
-	return res
+	return strings.Contains(tgErr.Message, "can't parse entities")
 }
 
 func parseInt64(s string) (int64, error) {
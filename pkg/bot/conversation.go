@@ -0,0 +1,190 @@
+package bot
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// defaultMaxConversationTurns bounds how many non-system turns are kept per
+// conversation before the oldest are dropped.
+const defaultMaxConversationTurns = 20
+
+// ConversationStore persists a rolling per-user/chat message history so the
+// bot can hold multi-turn conversations instead of treating every message as
+// a one-off prompt. It has its own DB connection (cfg.ConversationDBPath),
+// independent of auth.UserStore, so conversation memory works whether or not
+// auth is enabled. Like auth.UserStore, a nil db turns every method into a
+// no-op, which callers (tests, mainly) can rely on.
+type ConversationStore struct {
+	db       *sql.DB
+	maxTurns int
+}
+
+// NewConversationStore creates the conversations table (if needed) on db and
+// returns a store bounded to maxTurns non-system messages per conversation.
+// A nil db yields a disabled store that silently no-ops everywhere.
+func NewConversationStore(db *sql.DB, maxTurns int) (*ConversationStore, error) {
+	if db == nil {
+		return &ConversationStore{}, nil
+	}
+	if maxTurns <= 0 {
+		maxTurns = defaultMaxConversationTurns
+	}
+
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS conversations (
+			telegram_id INTEGER NOT NULL,
+			chat_id     INTEGER NOT NULL,
+			seq         INTEGER NOT NULL,
+			role        TEXT NOT NULL,
+			content     TEXT NOT NULL,
+			created_at  TEXT NOT NULL,
+			PRIMARY KEY (telegram_id, chat_id, seq)
+		);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("create table conversations: %w", err)
+	}
+
+	return &ConversationStore{db: db, maxTurns: maxTurns}, nil
+}
+
+// MaxTurns returns the configured non-system turn window.
+func (c *ConversationStore) MaxTurns() int {
+	if c == nil {
+		return 0
+	}
+	return c.maxTurns
+}
+
+// History returns the stored system message (if any) followed by the
+// remembered turns, in order, ready to drop straight into
+// OllamaChatRequest.Messages.
+func (c *ConversationStore) History(userID, chatID int64) ([]OllamaMessage, error) {
+	if c == nil || c.db == nil {
+		return nil, nil
+	}
+
+	rows, err := c.db.Query(`
+		SELECT role, content
+		FROM conversations
+		WHERE telegram_id = ? AND chat_id = ?
+		ORDER BY seq ASC
+	`, userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []OllamaMessage
+	for rows.Next() {
+		var m OllamaMessage
+		if err := rows.Scan(&m.Role, &m.Content); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// AppendTurn records a single message in the conversation and trims the
+// oldest non-system turns once the configured window is exceeded.
+func (c *ConversationStore) AppendTurn(userID, chatID int64, role, content string) error {
+	if c == nil || c.db == nil {
+		return nil
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := c.db.Exec(`
+		INSERT INTO conversations (telegram_id, chat_id, seq, role, content, created_at)
+		VALUES (
+			?, ?,
+			COALESCE((SELECT MAX(seq) FROM conversations WHERE telegram_id = ? AND chat_id = ?), 0) + 1,
+			?, ?, ?
+		)
+	`, userID, chatID, userID, chatID, role, content, now)
+	if err != nil {
+		return err
+	}
+
+	return c.trim(userID, chatID)
+}
+
+// SetSystem replaces the conversation's system message, inserting it ahead
+// of all existing turns.
+func (c *ConversationStore) SetSystem(userID, chatID int64, prompt string) error {
+	if c == nil || c.db == nil {
+		return nil
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		DELETE FROM conversations WHERE telegram_id = ? AND chat_id = ? AND role = 'system'
+	`, userID, chatID); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := tx.Exec(`
+		INSERT INTO conversations (telegram_id, chat_id, seq, role, content, created_at)
+		VALUES (
+			?, ?,
+			COALESCE((SELECT MIN(seq) FROM conversations WHERE telegram_id = ? AND chat_id = ?), 1) - 1,
+			'system', ?, ?
+		)
+	`, userID, chatID, userID, chatID, prompt, now); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Reset clears all remembered turns (including any system message) for a
+// user/chat.
+func (c *ConversationStore) Reset(userID, chatID int64) error {
+	if c == nil || c.db == nil {
+		return nil
+	}
+	_, err := c.db.Exec(`
+		DELETE FROM conversations WHERE telegram_id = ? AND chat_id = ?
+	`, userID, chatID)
+	return err
+}
+
+// TurnCount returns the number of non-system turns currently remembered.
+func (c *ConversationStore) TurnCount(userID, chatID int64) (int, error) {
+	if c == nil || c.db == nil {
+		return 0, nil
+	}
+
+	var n int
+	err := c.db.QueryRow(`
+		SELECT COUNT(*) FROM conversations
+		WHERE telegram_id = ? AND chat_id = ? AND role != 'system'
+	`, userID, chatID).Scan(&n)
+	return n, err
+}
+
+// trim drops the oldest non-system turns once the conversation exceeds
+// c.maxTurns.
+func (c *ConversationStore) trim(userID, chatID int64) error {
+	_, err := c.db.Exec(`
+		DELETE FROM conversations
+		WHERE telegram_id = ? AND chat_id = ? AND role != 'system' AND seq NOT IN (
+			SELECT seq FROM conversations
+			WHERE telegram_id = ? AND chat_id = ? AND role != 'system'
+			ORDER BY seq DESC
+			LIMIT ?
+		)
+	`, userID, chatID, userID, chatID, c.maxTurns)
+	return err
+}
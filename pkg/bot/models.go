@@ -0,0 +1,134 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// modelsCacheTTL bounds how long ListModels trusts a previous /api/tags
+// response before refetching.
+const modelsCacheTTL = 60 * time.Second
+
+// modelsFetchTimeout bounds a single /api/tags request so a slow or hung
+// Ollama backend can't stall the caller indefinitely.
+const modelsFetchTimeout = 10 * time.Second
+
+// modelsCache holds the most recent ListModels result.
+type modelsCache struct {
+	mu        sync.Mutex
+	models    []string
+	fetchedAt time.Time
+}
+
+// tagsResponse mirrors the subset of Ollama's GET /api/tags payload we need.
+type tagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// ListModels returns the names of models Ollama currently reports via
+// /api/tags, served from a ~60s cache to avoid hammering the backend on
+// every /model or /models invocation.
+func (b *Bot) ListModels(ctx context.Context) ([]string, error) {
+	b.modelsCache.mu.Lock()
+	if b.modelsCache.models != nil && time.Since(b.modelsCache.fetchedAt) < modelsCacheTTL {
+		models := b.modelsCache.models
+		b.modelsCache.mu.Unlock()
+		return models, nil
+	}
+	b.modelsCache.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.ollamaBaseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http get: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama HTTP %d", resp.StatusCode)
+	}
+
+	var tags tagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("decode /api/tags response: %w", err)
+	}
+
+	models := make([]string, len(tags.Models))
+	for i, m := range tags.Models {
+		models[i] = m.Name
+	}
+
+	b.modelsCache.mu.Lock()
+	b.modelsCache.models = models
+	b.modelsCache.fetchedAt = time.Now()
+	b.modelsCache.mu.Unlock()
+
+	return models, nil
+}
+
+// modelMatch pairs a candidate model name with its Levenshtein distance to
+// the user's query, closest first.
+type modelMatch struct {
+	Name     string
+	Distance int
+}
+
+// fuzzyMatchModels scores every candidate against query by case-insensitive
+// Levenshtein distance and returns them sorted closest-first.
+func fuzzyMatchModels(query string, models []string) []modelMatch {
+	q := strings.ToLower(query)
+
+	matches := make([]modelMatch, len(models))
+	for i, m := range models {
+		matches[i] = modelMatch{Name: m, Distance: levenshteinDistance(q, strings.ToLower(m))}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Distance < matches[j].Distance })
+	return matches
+}
+
+// levenshteinDistance returns the edit distance between a and b.
+func levenshteinDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(curr[j-1]+1, prev[j]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(br)]
+}
+
+func min3(a, b, c int) int {
+	m := a
+	if b < m {
+		m = b
+	}
+	if c < m {
+		m = c
+	}
+	return m
+}
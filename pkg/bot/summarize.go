@@ -0,0 +1,234 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golang.org/x/net/html"
+)
+
+// defaultSummarizePrompt is the system message used for /summarize requests,
+// distinct from defaultSystemPrompt used for regular chat.
+const defaultSummarizePrompt = "You are a concise summarization assistant. Summarize the following content " +
+	"in a few clear bullet points, focusing on the key facts and conclusions. Answer in Markdown."
+
+const (
+	summarizeFetchTimeout  = 15 * time.Second
+	summarizeMaxRedirects  = 5
+	summarizeMaxFetchBytes = 2 << 20 // 2MiB
+	summarizeMaxDocBytes   = 1 << 20 // 1MiB
+)
+
+var summarizeHTTPClient = &http.Client{
+	Timeout: summarizeFetchTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= summarizeMaxRedirects {
+			return fmt.Errorf("too many redirects")
+		}
+		return nil
+	},
+}
+
+// bareURLPattern catches a message that is essentially just a URL, so it can
+// be auto-summarized without requiring /summarize.
+var bareURLPattern = regexp.MustCompile(`^https?://\S+$`)
+
+func (b *Bot) handleSummarize(chatID, userID int64, text string) {
+	target := strings.TrimSpace(strings.TrimPrefix(text, "/summarize"))
+	if target == "" {
+		msg := tgbotapi.NewMessage(chatID, "Usage: /summarize <url>")
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	if _, err := url.ParseRequestURI(target); err != nil {
+		msg := tgbotapi.NewMessage(chatID, "That doesn't look like a valid URL.")
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	_, _ = b.api.Send(tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping))
+
+	ctx := b.startStream(chatID)
+	go func(ctx context.Context, chatID, userID int64) {
+		defer b.endStream(chatID, ctx)
+
+		fetchCtx, cancel := context.WithTimeout(ctx, summarizeFetchTimeout)
+		defer cancel()
+
+		content, err := fetchAndExtractText(fetchCtx, target)
+		if err != nil {
+			log.Printf("summarize fetch error for %q: %v", target, err)
+			msg := tgbotapi.NewMessage(chatID, "âš ï¸ Failed to fetch URL: "+err.Error())
+			_, _ = b.api.Send(msg)
+			return
+		}
+
+		b.summarizeStream(ctx, chatID, userID, content)
+	}(ctx, chatID, userID)
+}
+
+// handleDocument downloads a plain-text/Markdown Telegram document attachment
+// and feeds its contents into the same summarization path as /summarize.
+func (b *Bot) handleDocument(chatID, userID int64, doc *tgbotapi.Document) {
+	if doc.MimeType != "text/plain" && doc.MimeType != "text/markdown" {
+		msg := tgbotapi.NewMessage(chatID, "I can only summarize text/plain or text/markdown documents.")
+		_, _ = b.api.Send(msg)
+		return
+	}
+	if doc.FileSize > summarizeMaxDocBytes {
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("That document is too large to summarize (max %d bytes).", summarizeMaxDocBytes))
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	_, _ = b.api.Send(tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping))
+
+	ctx := b.startStream(chatID)
+	go func(ctx context.Context, chatID, userID int64) {
+		defer b.endStream(chatID, ctx)
+
+		file, err := b.api.GetFile(tgbotapi.FileConfig{FileID: doc.FileID})
+		if err != nil {
+			log.Printf("GetFile error for doc %s: %v", doc.FileID, err)
+			msg := tgbotapi.NewMessage(chatID, "âš ï¸ Failed to download document: "+err.Error())
+			_, _ = b.api.Send(msg)
+			return
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, summarizeFetchTimeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(fetchCtx, http.MethodGet, file.Link(b.api.Token), nil)
+		if err != nil {
+			log.Printf("build document download request: %v", err)
+			return
+		}
+
+		resp, err := summarizeHTTPClient.Do(req)
+		if err != nil {
+			log.Printf("download document %s: %v", doc.FileID, err)
+			msg := tgbotapi.NewMessage(chatID, "âš ï¸ Failed to download document: "+err.Error())
+			_, _ = b.api.Send(msg)
+			return
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, summarizeMaxDocBytes))
+		if err != nil {
+			log.Printf("read document %s: %v", doc.FileID, err)
+			return
+		}
+
+		b.summarizeStream(ctx, chatID, userID, string(body))
+	}(ctx, chatID, userID)
+}
+
+// summarizeStream streams a summary of content back to chatID using
+// b.summarizeModel and b.summarizePrompt, independent of the user's regular
+// conversation history. Callers are expected to already be running inside
+// the goroutine registered by b.startStream(chatID).
+func (b *Bot) summarizeStream(ctx context.Context, chatID, userID int64, content string) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		msg := tgbotapi.NewMessage(chatID, "There was nothing to summarize.")
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	messages := []OllamaMessage{
+		{Role: "system", Content: b.summarizePrompt},
+		{Role: "user", Content: content},
+	}
+
+	placeholder, err := b.api.Send(tgbotapi.NewMessage(chatID, "..."))
+	if err != nil {
+		log.Printf("failed to send placeholder message: %v", err)
+		return
+	}
+	streamer := newMessageStreamer(b.api, chatID, placeholder.MessageID)
+
+	var full strings.Builder
+	err = b.streamOllama(ctx, b.summarizeModel, messages, func(delta string, done bool) error {
+		full.WriteString(delta)
+		return streamer.append(delta, done)
+	})
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		log.Printf("summarize ollama error: %v", err)
+		msg := tgbotapi.NewMessage(chatID, "âš ï¸ Error from backend: "+err.Error())
+		_, _ = b.api.Send(msg)
+		return
+	}
+
+	if err := b.quota.RecordUsage(userID, len(content), full.Len()); err != nil {
+		log.Printf("failed to record quota usage for %d: %v", userID, err)
+	}
+}
+
+// fetchAndExtractText downloads target with a bounded client (timeout, size
+// cap, redirect limit) and strips its HTML down to plain text.
+func fetchAndExtractText(ctx context.Context, target string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("User-Agent", "ollamabot/1.0 (+https://github.com/nexusriot/ollamabot)")
+
+	resp, err := summarizeHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	body := io.LimitReader(resp.Body, summarizeMaxFetchBytes)
+	return stripHTML(body)
+}
+
+// stripHTML walks r as an HTML document and returns its visible text,
+// dropping <script> and <style> content.
+func stripHTML(r io.Reader) (string, error) {
+	tokenizer := html.NewTokenizer(r)
+
+	var sb strings.Builder
+	skipping := false
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); err != nil && err != io.EOF {
+				return "", err
+			}
+			return sb.String(), nil
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			if string(name) == "script" || string(name) == "style" {
+				skipping = true
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if string(name) == "script" || string(name) == "style" {
+				skipping = false
+			}
+		case html.TextToken:
+			if !skipping {
+				sb.Write(tokenizer.Text())
+				sb.WriteByte(' ')
+			}
+		}
+	}
+}
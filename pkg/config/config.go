@@ -0,0 +1,202 @@
+// Package config centralizes ollamabot's configuration: a YAML file loaded
+// from --config, overridden by the same environment variables main used to
+// read directly, then validated before the bot starts.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AuthConfig mirrors auth.AuthConfig; it's redeclared here (rather than
+// imported) so this package has no dependency on pkg/auth.
+type AuthConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	AdminID int64  `yaml:"admin_id"`
+	DBPath  string `yaml:"db_path"`
+}
+
+// RateLimit bounds how often a single user may prompt the bot: a
+// token-bucket of size Burst refilling at RequestsPerMinute, a persistent
+// RequestsPerDay cap, and a MaxPromptChars cap on any single message. Zero
+// disables the corresponding check.
+type RateLimit struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	Burst             int `yaml:"burst"`
+	RequestsPerDay    int `yaml:"requests_per_day"`
+	MaxPromptChars    int `yaml:"max_prompt_chars"`
+}
+
+// Config is ollamabot's full configuration. TelegramToken, OllamaBaseURL,
+// Auth, ConversationDBPath and ConversationMaxTurns take effect only at
+// startup; Model, SystemPrompt, AllowedModels, RateLimit and AdminRateLimit
+// are hot-reloadable (see Watcher).
+type Config struct {
+	TelegramToken        string     `yaml:"telegram_token"`
+	OllamaBaseURL        string     `yaml:"ollama_base_url"`
+	Model                string     `yaml:"model"`
+	SummarizeModel       string     `yaml:"summarize_model"`
+	SystemPrompt         string     `yaml:"system_prompt"`
+	AllowedModels        []string   `yaml:"allowed_models"`
+	RateLimit            RateLimit  `yaml:"rate_limit"`
+	AdminRateLimit       RateLimit  `yaml:"admin_rate_limit"`
+	Auth                 AuthConfig `yaml:"auth"`
+	ConversationDBPath   string     `yaml:"conversation_db_path"`
+	ConversationMaxTurns int        `yaml:"conversation_max_turns"`
+}
+
+// defaultOllamaBaseURL matches the fallback previously hardcoded in main.
+const defaultOllamaBaseURL = "http://ollama:11434"
+
+// defaultAuthDBPath matches the fallback previously hardcoded in main.
+const defaultAuthDBPath = "/var/lib/ollamabot/bot_users.db"
+
+// defaultConversationDBPath is used regardless of whether auth is enabled,
+// so per-user conversation memory works in the bot's default (auth-disabled)
+// deployment mode too. Unlike defaultAuthDBPath it's relative to the
+// process's working directory rather than under /var/lib/ollamabot: auth
+// is an opt-in feature whose operators already provision that directory,
+// but conversation memory is on by default and must not turn a zero-config
+// deployment into one that fails to start without a pre-provisioned,
+// writable /var/lib/ollamabot.
+const defaultConversationDBPath = "bot_conversations.db"
+
+// defaultConversationMaxTurns bounds how many non-system turns are kept per
+// conversation before the oldest are dropped, unless overridden.
+const defaultConversationMaxTurns = 20
+
+// Load reads path (if non-empty) as YAML, applies environment variable
+// overrides on top (env always wins over the file), fills in defaults, and
+// validates the result. path may be empty to configure purely from the
+// environment, matching the pre-config-file behavior.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parse config file: %w", err)
+		}
+	}
+
+	applyEnvOverrides(cfg)
+
+	if cfg.OllamaBaseURL == "" {
+		cfg.OllamaBaseURL = defaultOllamaBaseURL
+	}
+	if cfg.Auth.Enabled && cfg.Auth.DBPath == "" {
+		cfg.Auth.DBPath = defaultAuthDBPath
+	}
+	if cfg.ConversationDBPath == "" {
+		cfg.ConversationDBPath = defaultConversationDBPath
+	}
+	if cfg.ConversationMaxTurns <= 0 {
+		cfg.ConversationMaxTurns = defaultConversationMaxTurns
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnvOverrides mutates cfg in place with any of the legacy env vars
+// that are set, so a deployment can keep using them without a config file,
+// or override individual fields of one.
+func applyEnvOverrides(cfg *Config) {
+	if v := os.Getenv("TELEGRAM_BOT_TOKEN"); v != "" {
+		cfg.TelegramToken = v
+	}
+	if v := os.Getenv("OLLAMA_BASE_URL"); v != "" {
+		cfg.OllamaBaseURL = v
+	}
+	if v := os.Getenv("OLLAMA_MODEL"); v != "" {
+		cfg.Model = v
+	}
+	if v := os.Getenv("OLLAMA_SUMMARIZE_MODEL"); v != "" {
+		cfg.SummarizeModel = v
+	}
+	if v := os.Getenv("BOT_SYSTEM_PROMPT"); v != "" {
+		cfg.SystemPrompt = v
+	}
+	if v := os.Getenv("BOT_ALLOWED_MODELS"); v != "" {
+		cfg.AllowedModels = strings.Split(v, ",")
+		for i := range cfg.AllowedModels {
+			cfg.AllowedModels[i] = strings.TrimSpace(cfg.AllowedModels[i])
+		}
+	}
+	applyRateLimitEnv(&cfg.RateLimit, "BOT_RATE_LIMIT")
+	applyRateLimitEnv(&cfg.AdminRateLimit, "BOT_ADMIN_RATE_LIMIT")
+
+	if v := os.Getenv("BOT_AUTH_ENABLED"); v != "" {
+		cfg.Auth.Enabled = strings.EqualFold(v, "1") ||
+			strings.EqualFold(v, "true") ||
+			strings.EqualFold(v, "yes")
+	}
+	if v := os.Getenv("BOT_ADMIN_ID"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.Auth.AdminID = n
+		}
+	}
+	if v := os.Getenv("BOT_AUTH_DB_PATH"); v != "" {
+		cfg.Auth.DBPath = v
+	}
+	if v := os.Getenv("BOT_CONVERSATION_DB_PATH"); v != "" {
+		cfg.ConversationDBPath = v
+	}
+	if v := os.Getenv("BOT_CONVERSATION_MAX_TURNS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.ConversationMaxTurns = n
+		}
+	}
+}
+
+// applyRateLimitEnv overrides rl's fields from <prefix>_PER_MINUTE,
+// <prefix>_BURST, <prefix>_PER_DAY and <prefix>_MAX_PROMPT_CHARS, so
+// RateLimit and AdminRateLimit share the same env var scheme under
+// different prefixes.
+func applyRateLimitEnv(rl *RateLimit, prefix string) {
+	if v := os.Getenv(prefix + "_PER_MINUTE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			rl.RequestsPerMinute = n
+		}
+	}
+	if v := os.Getenv(prefix + "_BURST"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			rl.Burst = n
+		}
+	}
+	if v := os.Getenv(prefix + "_PER_DAY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			rl.RequestsPerDay = n
+		}
+	}
+	if v := os.Getenv(prefix + "_MAX_PROMPT_CHARS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			rl.MaxPromptChars = n
+		}
+	}
+}
+
+// Validate reports whether cfg is complete enough to start the bot.
+func (c *Config) Validate() error {
+	if c.TelegramToken == "" {
+		return fmt.Errorf("telegram_token is required (set it in the config file or TELEGRAM_BOT_TOKEN)")
+	}
+	if c.Auth.Enabled {
+		if c.Auth.AdminID == 0 {
+			return fmt.Errorf("auth.enabled is true but auth.admin_id is 0")
+		}
+		if c.Auth.DBPath == "" {
+			return fmt.Errorf("auth.enabled is true but auth.db_path is empty")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"log"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce absorbs editors that emit several fs events (write, chmod,
+// rename-into-place) for a single save.
+const reloadDebounce = 200 * time.Millisecond
+
+// Reloadable receives a freshly loaded Config whenever the watched file
+// changes. Implementations should only adopt the fields that are safe to
+// change without a restart (e.g. Bot ignores TelegramToken and Auth).
+type Reloadable interface {
+	ApplyConfig(cfg *Config)
+}
+
+// Watcher reloads a config file on change and pushes the result to a
+// Reloadable. Fields that require a restart (token, DB path) are present in
+// every reload but are expected to be ignored by ApplyConfig.
+type Watcher struct {
+	path   string
+	target Reloadable
+	fsw    *fsnotify.Watcher
+	done   chan struct{}
+}
+
+// NewWatcher starts watching path and calls target.ApplyConfig on every
+// subsequent change. The initial load (performed by the caller via Load) is
+// not pushed through target; NewWatcher only reacts to future edits.
+func NewWatcher(path string, target Reloadable) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := fsw.Add(path); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+
+	w := &Watcher{path: path, target: target, fsw: fsw, done: make(chan struct{})}
+	go w.run()
+	return w, nil
+}
+
+// run debounces bursts of fs events and reloads once they settle.
+func (w *Watcher) run() {
+	var timer *time.Timer
+	reload := make(chan struct{}, 1)
+
+	for {
+		select {
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			if timer == nil {
+				timer = time.AfterFunc(reloadDebounce, func() {
+					select {
+					case reload <- struct{}{}:
+					default:
+					}
+				})
+			} else {
+				timer.Reset(reloadDebounce)
+			}
+
+		case <-reload:
+			cfg, err := Load(w.path)
+			if err != nil {
+				log.Printf("config: reload of %s failed, keeping previous config: %v", w.path, err)
+				continue
+			}
+			log.Printf("config: reloaded %s", w.path)
+			w.target.ApplyConfig(cfg)
+
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("config: watch error: %v", err)
+
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	close(w.done)
+	return w.fsw.Close()
+}
@@ -0,0 +1,189 @@
+// Package quota enforces per-user rate limits and tracks daily usage.
+// Burst limiting is an in-memory token bucket; request/char counts are
+// persisted so daily caps survive a restart.
+package quota
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limits configures enforcement for one tier (regular user or admin). Zero
+// disables the corresponding check.
+type Limits struct {
+	RequestsPerMinute int
+	Burst             int
+	RequestsPerDay    int
+	MaxPromptChars    int
+}
+
+// Reason identifies why a Result rejected a request.
+type Reason string
+
+const (
+	ReasonBurst         Reason = "burst"
+	ReasonDailyCap      Reason = "daily_cap"
+	ReasonPromptTooLong Reason = "prompt_too_long"
+)
+
+// Result is the outcome of a Store.Allow check.
+type Result struct {
+	Allowed    bool
+	Reason     Reason
+	RetryAfter time.Duration // set when Reason is ReasonBurst
+}
+
+// Usage is one user's counters for a single day.
+type Usage struct {
+	Day             string
+	Requests        int
+	PromptChars     int
+	CompletionChars int
+}
+
+// bucket is a per-user token bucket for burst limiting.
+type bucket struct {
+	tokens   float64
+	lastFill time.Time
+}
+
+// Store enforces Limits per Telegram user ID. A nil db (auth disabled)
+// yields a store that still enforces burst limiting in-memory but treats
+// daily caps as unlimited, matching the nil/disabled-safe style used
+// elsewhere in this codebase.
+type Store struct {
+	db *sql.DB
+
+	mu      sync.Mutex
+	buckets map[int64]*bucket
+}
+
+// NewStore creates the user_usage table (if needed) on db.
+func NewStore(db *sql.DB) (*Store, error) {
+	s := &Store{db: db, buckets: make(map[int64]*bucket)}
+	if db == nil {
+		return s, nil
+	}
+
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_usage (
+			telegram_id      INTEGER NOT NULL,
+			day              TEXT NOT NULL,
+			requests         INTEGER NOT NULL DEFAULT 0,
+			prompt_chars     INTEGER NOT NULL DEFAULT 0,
+			completion_chars INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (telegram_id, day)
+		);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("create table user_usage: %w", err)
+	}
+	return s, nil
+}
+
+// Allow reports whether userID may send a promptChars-long message under
+// limits, checking (in order) MaxPromptChars, RequestsPerDay and the
+// RequestsPerMinute token bucket. It does not record anything; call
+// RecordUsage once the request actually completes.
+func (s *Store) Allow(userID int64, limits Limits, promptChars int) (Result, error) {
+	if limits.MaxPromptChars > 0 && promptChars > limits.MaxPromptChars {
+		return Result{Reason: ReasonPromptTooLong}, nil
+	}
+
+	if limits.RequestsPerDay > 0 {
+		usage, err := s.Today(userID)
+		if err != nil {
+			return Result{}, err
+		}
+		if usage.Requests >= limits.RequestsPerDay {
+			return Result{Reason: ReasonDailyCap}, nil
+		}
+	}
+
+	if limits.RequestsPerMinute > 0 {
+		if retryAfter, ok := s.takeToken(userID, limits); !ok {
+			return Result{Reason: ReasonBurst, RetryAfter: retryAfter}, nil
+		}
+	}
+
+	return Result{Allowed: true}, nil
+}
+
+// takeToken refills userID's bucket for elapsed time and consumes one
+// token if available. capacity defaults to RequestsPerMinute when Burst is
+// unset, so a bare "requests per minute" config works without tuning Burst.
+func (s *Store) takeToken(userID int64, limits Limits) (retryAfter time.Duration, ok bool) {
+	capacity := float64(limits.Burst)
+	if capacity <= 0 {
+		capacity = float64(limits.RequestsPerMinute)
+	}
+	refillPerSec := float64(limits.RequestsPerMinute) / 60
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	b, exists := s.buckets[userID]
+	if !exists {
+		b = &bucket{tokens: capacity, lastFill: now}
+		s.buckets[userID] = b
+	} else {
+		b.tokens += now.Sub(b.lastFill).Seconds() * refillPerSec
+		if b.tokens > capacity {
+			b.tokens = capacity
+		}
+		b.lastFill = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	wait := (1 - b.tokens) / refillPerSec
+	return time.Duration(wait * float64(time.Second)), false
+}
+
+// Today returns userID's usage counters for the current UTC day.
+func (s *Store) Today(userID int64) (Usage, error) {
+	usage := Usage{Day: currentDay()}
+	if s.db == nil {
+		return usage, nil
+	}
+
+	err := s.db.QueryRow(`
+		SELECT requests, prompt_chars, completion_chars FROM user_usage
+		WHERE telegram_id = ? AND day = ?
+	`, userID, usage.Day).Scan(&usage.Requests, &usage.PromptChars, &usage.CompletionChars)
+	if err == sql.ErrNoRows {
+		return usage, nil
+	}
+	if err != nil {
+		return Usage{}, err
+	}
+	return usage, nil
+}
+
+// RecordUsage adds one request (with the given char counts) to userID's
+// counters for the current UTC day.
+func (s *Store) RecordUsage(userID int64, promptChars, completionChars int) error {
+	if s.db == nil {
+		return nil
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO user_usage (telegram_id, day, requests, prompt_chars, completion_chars)
+		VALUES (?, ?, 1, ?, ?)
+		ON CONFLICT(telegram_id, day) DO UPDATE SET
+			requests = requests + 1,
+			prompt_chars = prompt_chars + excluded.prompt_chars,
+			completion_chars = completion_chars + excluded.completion_chars
+	`, userID, currentDay(), promptChars, completionChars)
+	return err
+}
+
+func currentDay() string {
+	return time.Now().UTC().Format("2006-01-02")
+}